@@ -0,0 +1,261 @@
+package bans
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Config holds the thresholds and trust settings that drive a Monitor.
+type Config struct {
+	// MaxAnnouncesPerSecond is how many distinct info_hashes a single IP
+	// may announce for within a one-second window before it's banned.
+	MaxAnnouncesPerSecond int
+	// MaxMalformedRequests is how many malformed requests a single IP
+	// may send within a one-second window before it's banned.
+	MaxMalformedRequests int
+	// BanDuration is how long a ban lasts once triggered.
+	BanDuration time.Duration
+	// TrustedProxies lists the CIDRs allowed to supply a client IP via
+	// X-Forwarded-For; requests from anywhere else have the header
+	// ignored in favor of the socket's remote address.
+	TrustedProxies []*net.IPNet
+	// ValidatePeerReachability, when true, asynchronously dials back
+	// peers that announce a "started" event to confirm they're
+	// reachable on the port they advertised.
+	ValidatePeerReachability bool
+	// DialWorkers bounds the worker pool used for reachability checks.
+	DialWorkers int
+	// DialTimeout bounds each reachability dial.
+	DialTimeout time.Duration
+	// UnreachableBanThreshold is how many distinct torrents an IP must
+	// fail a reachability dial for before it's banned. Most real peers
+	// are NAT'd or firewalled and won't answer an inbound dial, so a
+	// single failure is low-signal and not banned on by itself; this
+	// defaults to 0, which disables reachability-based banning entirely.
+	UnreachableBanThreshold int
+}
+
+// ipActivity is the one-second window of recent behavior tracked per IP;
+// it starts afresh once a full second has passed since windowStart.
+type ipActivity struct {
+	windowStart time.Time
+	hashes      map[[20]byte]struct{}
+	malformed   int
+}
+
+// dialCheck is a queued outbound reachability probe, scoped to the
+// specific torrent whose announce triggered it.
+type dialCheck struct {
+	ip       net.IP
+	port     uint16
+	infoHash [20]byte
+}
+
+// Monitor watches per-IP request activity, bans IPs that cross the
+// configured thresholds, and answers whether a given IP is currently
+// banned or its X-Forwarded-For header should be trusted.
+type Monitor struct {
+	cfg   Config
+	store Store
+
+	mu          sync.Mutex
+	counts      map[string]*ipActivity
+	unreachable map[string]map[[20]byte]struct{}
+
+	dialQueue chan dialCheck
+}
+
+// NewMonitor starts cfg.DialWorkers reachability-check workers (if
+// cfg.ValidatePeerReachability) and returns a Monitor backed by store.
+func NewMonitor(cfg Config, store Store) *Monitor {
+	m := &Monitor{
+		cfg:         cfg,
+		store:       store,
+		counts:      make(map[string]*ipActivity),
+		unreachable: make(map[string]map[[20]byte]struct{}),
+		dialQueue:   make(chan dialCheck, 1024),
+	}
+	if cfg.ValidatePeerReachability {
+		workers := cfg.DialWorkers
+		if workers <= 0 {
+			workers = 4
+		}
+		for i := 0; i < workers; i++ {
+			go m.dialWorker()
+		}
+	}
+	return m
+}
+
+// DefaultBanDuration returns the configured ban duration, for callers
+// (e.g. the admin API) that ban an IP manually without specifying one.
+func (m *Monitor) DefaultBanDuration() time.Duration {
+	return m.cfg.BanDuration
+}
+
+// Ban manually bans ip for duration, for operator-initiated bans.
+func (m *Monitor) Ban(ip net.IP, duration time.Duration) error {
+	return m.store.Ban(ip.String(), duration)
+}
+
+// Unban lifts any ban on ip, also resetting its tallied activity so a
+// freshly-unbanned IP isn't immediately re-banned by counters left over
+// from before the ban.
+func (m *Monitor) Unban(ip net.IP) error {
+	key := ip.String()
+	m.mu.Lock()
+	delete(m.counts, key)
+	delete(m.unreachable, key)
+	m.mu.Unlock()
+	return m.store.Unban(key)
+}
+
+// List returns every currently-banned IP.
+func (m *Monitor) List() ([]string, error) {
+	return m.store.List()
+}
+
+// IsBanned reports whether ip is currently banned.
+func (m *Monitor) IsBanned(ip net.IP) bool {
+	banned, err := m.store.IsBanned(ip.String())
+	if err != nil {
+		log.Errorf("bans: failed to check ban status for %s: %s", ip, err)
+		return false
+	}
+	return banned
+}
+
+// activity returns the current window for key, resetting it if a full
+// second has elapsed since it started.
+func (m *Monitor) activity(key string) *ipActivity {
+	a, ok := m.counts[key]
+	if !ok || time.Since(a.windowStart) >= time.Second {
+		a = &ipActivity{windowStart: time.Now(), hashes: make(map[[20]byte]struct{})}
+		m.counts[key] = a
+	}
+	return a
+}
+
+// RecordAnnounce tallies an announce from ip for infoHash and bans ip if
+// it crosses MaxAnnouncesPerSecond across distinct torrents within the
+// current one-second window.
+func (m *Monitor) RecordAnnounce(ip net.IP, infoHash [20]byte) {
+	if m.cfg.MaxAnnouncesPerSecond <= 0 {
+		return
+	}
+	key := ip.String()
+	m.mu.Lock()
+	a := m.activity(key)
+	a.hashes[infoHash] = struct{}{}
+	exceeded := len(a.hashes) > m.cfg.MaxAnnouncesPerSecond
+	m.mu.Unlock()
+	if exceeded {
+		m.ban(key)
+	}
+}
+
+// RecordMalformed tallies a malformed request from ip and bans it once it
+// crosses MaxMalformedRequests.
+func (m *Monitor) RecordMalformed(ip net.IP) {
+	if m.cfg.MaxMalformedRequests <= 0 {
+		return
+	}
+	key := ip.String()
+	m.mu.Lock()
+	a := m.activity(key)
+	a.malformed++
+	exceeded := a.malformed > m.cfg.MaxMalformedRequests
+	m.mu.Unlock()
+	if exceeded {
+		m.ban(key)
+	}
+}
+
+// ban bans ip and clears its tallied activity, so the counters that
+// triggered the ban don't also outlive it: once the ban expires (store
+// TTL or an operator's Unban), the IP starts from a clean slate instead
+// of being immediately re-banned by stale counts, and the unreachable
+// tally in particular can't grow without bound across a ban/unban cycle.
+func (m *Monitor) ban(ip string) {
+	if err := m.store.Ban(ip, m.cfg.BanDuration); err != nil {
+		log.Errorf("bans: failed to ban %s: %s", ip, err)
+		return
+	}
+	m.mu.Lock()
+	delete(m.counts, ip)
+	delete(m.unreachable, ip)
+	m.mu.Unlock()
+	log.Warnf("bans: banned %s for %s", ip, m.cfg.BanDuration)
+}
+
+// CheckReachable queues an asynchronous dial to ip:port for infoHash,
+// recording a reachability failure against the peer if it can't be
+// reached. Intended for "started" announces, where a peer claims a
+// listening port it may not actually be answering on. The queue is
+// bounded: a full queue drops the check rather than blocking the
+// announce that triggered it.
+func (m *Monitor) CheckReachable(ip net.IP, port uint16, infoHash [20]byte) {
+	if !m.cfg.ValidatePeerReachability {
+		return
+	}
+	select {
+	case m.dialQueue <- dialCheck{ip: ip, port: port, infoHash: infoHash}:
+	default:
+		log.Warnf("bans: dial queue full, dropping reachability check for %s:%d", ip, port)
+	}
+}
+
+func (m *Monitor) dialWorker() {
+	for c := range m.dialQueue {
+		addr := net.JoinHostPort(c.ip.String(), strconv.Itoa(int(c.port)))
+		conn, err := net.DialTimeout("tcp", addr, m.cfg.DialTimeout)
+		if err == nil {
+			_ = conn.Close()
+			continue
+		}
+		m.recordUnreachable(c.ip, c.infoHash)
+	}
+}
+
+// recordUnreachable tallies a failed reachability dial against ip,
+// scoped to the specific torrent that triggered it, and bans ip only
+// once it has failed reachability across UnreachableBanThreshold
+// distinct torrents. Most real BitTorrent peers are NAT'd or firewalled
+// and won't answer an inbound dial, so a single failure proves nothing
+// on its own; this is opt-in (UnreachableBanThreshold defaults to 0,
+// disabling reachability-based banning entirely), and a single torrent's
+// failure bans only when the threshold is set to 1.
+func (m *Monitor) recordUnreachable(ip net.IP, infoHash [20]byte) {
+	if m.cfg.UnreachableBanThreshold <= 0 {
+		return
+	}
+	key := ip.String()
+	m.mu.Lock()
+	hashes, ok := m.unreachable[key]
+	if !ok {
+		hashes = make(map[[20]byte]struct{})
+		m.unreachable[key] = hashes
+	}
+	hashes[infoHash] = struct{}{}
+	exceeded := len(hashes) >= m.cfg.UnreachableBanThreshold
+	m.mu.Unlock()
+	if exceeded {
+		m.ban(key)
+	}
+}
+
+// TrustForwardedFor reports whether remoteAddr falls within the
+// configured trusted-proxy CIDRs and so its X-Forwarded-For header should
+// be honored instead of ignored.
+func (m *Monitor) TrustForwardedFor(remoteAddr net.IP) bool {
+	for _, cidr := range m.cfg.TrustedProxies {
+		if cidr.Contains(remoteAddr) {
+			return true
+		}
+	}
+	return false
+}
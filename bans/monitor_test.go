@@ -0,0 +1,163 @@
+package bans
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRecordAnnounceBansAfterThreshold(t *testing.T) {
+	m := NewMonitor(Config{MaxAnnouncesPerSecond: 2, BanDuration: time.Minute}, NewMemoryStore())
+	ip := net.ParseIP("1.2.3.4")
+
+	var ih1, ih2, ih3 [20]byte
+	ih1[0], ih2[0], ih3[0] = 1, 2, 3
+
+	m.RecordAnnounce(ip, ih1)
+	m.RecordAnnounce(ip, ih2)
+	if m.IsBanned(ip) {
+		t.Fatal("must not ban before crossing MaxAnnouncesPerSecond")
+	}
+
+	m.RecordAnnounce(ip, ih3)
+	if !m.IsBanned(ip) {
+		t.Fatal("must ban once distinct info_hash count exceeds MaxAnnouncesPerSecond")
+	}
+}
+
+func TestRecordAnnounceWindowResets(t *testing.T) {
+	m := NewMonitor(Config{MaxAnnouncesPerSecond: 1, BanDuration: time.Minute}, NewMemoryStore())
+	ip := net.ParseIP("1.2.3.4")
+	var ih [20]byte
+
+	m.RecordAnnounce(ip, ih)
+
+	m.mu.Lock()
+	m.counts[ip.String()].windowStart = time.Now().Add(-2 * time.Second)
+	m.mu.Unlock()
+
+	var ih2 [20]byte
+	ih2[0] = 1
+	m.RecordAnnounce(ip, ih2)
+	if m.IsBanned(ip) {
+		t.Fatal("a new window must not carry over the previous window's distinct-hash count")
+	}
+}
+
+func TestRecordMalformedBansAfterThreshold(t *testing.T) {
+	m := NewMonitor(Config{MaxMalformedRequests: 2, BanDuration: time.Minute}, NewMemoryStore())
+	ip := net.ParseIP("5.6.7.8")
+
+	m.RecordMalformed(ip)
+	m.RecordMalformed(ip)
+	if m.IsBanned(ip) {
+		t.Fatal("must not ban before crossing MaxMalformedRequests")
+	}
+
+	m.RecordMalformed(ip)
+	if !m.IsBanned(ip) {
+		t.Fatal("must ban once malformed count exceeds MaxMalformedRequests")
+	}
+}
+
+func TestMemoryStoreBanExpires(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.Ban("9.9.9.9", -time.Second); err != nil {
+		t.Fatalf("Ban: %s", err)
+	}
+	banned, err := store.IsBanned("9.9.9.9")
+	if err != nil {
+		t.Fatalf("IsBanned: %s", err)
+	}
+	if banned {
+		t.Fatal("a ban whose duration has already elapsed must not report as banned")
+	}
+}
+
+func TestCheckReachableDoesNotBanByDefault(t *testing.T) {
+	// A single unreachable dial is the common case for NAT'd/firewalled
+	// peers, so with the threshold unset (disabled) it must never ban.
+	m := NewMonitor(Config{
+		ValidatePeerReachability: true,
+		DialWorkers:              1,
+		DialTimeout:              50 * time.Millisecond,
+		BanDuration:              time.Minute,
+	}, NewMemoryStore())
+	ip := net.ParseIP("127.0.0.1")
+	var ih [20]byte
+
+	// Port 1 on loopback is never listening in this sandbox, so the dial
+	// reliably fails.
+	m.CheckReachable(ip, 1, ih)
+	waitForDialQueueDrain(m)
+
+	if m.IsBanned(ip) {
+		t.Fatal("a single failed reachability dial must not ban an IP by default")
+	}
+}
+
+func TestCheckReachableBansAfterDistinctTorrentThreshold(t *testing.T) {
+	m := NewMonitor(Config{
+		ValidatePeerReachability: true,
+		UnreachableBanThreshold:  2,
+		DialWorkers:              1,
+		DialTimeout:              50 * time.Millisecond,
+		BanDuration:              time.Minute,
+	}, NewMemoryStore())
+	ip := net.ParseIP("127.0.0.1")
+	var ih1, ih2 [20]byte
+	ih1[0], ih2[0] = 1, 2
+
+	m.CheckReachable(ip, 1, ih1)
+	waitForDialQueueDrain(m)
+	if m.IsBanned(ip) {
+		t.Fatal("must not ban before the distinct-torrent threshold is crossed")
+	}
+
+	m.CheckReachable(ip, 1, ih2)
+	waitForDialQueueDrain(m)
+	if !m.IsBanned(ip) {
+		t.Fatal("must ban once failures span UnreachableBanThreshold distinct torrents")
+	}
+}
+
+func TestBanResetsUnreachableTally(t *testing.T) {
+	// Once banned, an IP's tally must not outlive the ban: otherwise the
+	// very next single failed dial after the ban expires (or an operator
+	// unbans it) would immediately cross the threshold again and re-ban
+	// it forever.
+	m := NewMonitor(Config{
+		ValidatePeerReachability: true,
+		UnreachableBanThreshold:  1,
+		DialWorkers:              1,
+		DialTimeout:              50 * time.Millisecond,
+		BanDuration:              time.Minute,
+	}, NewMemoryStore())
+	ip := net.ParseIP("127.0.0.1")
+	var ih [20]byte
+
+	m.CheckReachable(ip, 1, ih)
+	waitForDialQueueDrain(m)
+	if !m.IsBanned(ip) {
+		t.Fatal("expected ban once the (threshold-of-1) distinct-torrent count was crossed")
+	}
+
+	m.mu.Lock()
+	_, stillTracked := m.unreachable[ip.String()]
+	m.mu.Unlock()
+	if stillTracked {
+		t.Fatal("expected the unreachable tally to be cleared once the IP is banned")
+	}
+}
+
+// waitForDialQueueDrain polls until the dial queue is empty, so tests
+// don't race the asynchronous dialWorker goroutines.
+func waitForDialQueueDrain(m *Monitor) {
+	deadline := time.Now().Add(time.Second)
+	for len(m.dialQueue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// Give the worker a moment to finish processing the last item it
+	// popped off the (now empty) channel.
+	time.Sleep(50 * time.Millisecond)
+}
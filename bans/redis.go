@@ -0,0 +1,58 @@
+package bans
+
+import (
+	"strings"
+	"time"
+
+	redis "github.com/go-redis/redis/v7"
+)
+
+// redisKeyPrefix namespaces ban keys so they don't collide with any other
+// data mika's Redis storage driver keeps in the same database.
+const redisKeyPrefix = "mika:ban:"
+
+// RedisStore keeps bans in Redis so every node in a multi-node
+// deployment shares the same banned-IP set, using the key's own TTL to
+// expire bans rather than a background sweep.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore returns a RedisStore backed by client.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Ban marks ip as banned for duration.
+func (r *RedisStore) Ban(ip string, duration time.Duration) error {
+	return r.client.Set(redisKeyPrefix+ip, "1", duration).Err()
+}
+
+// Unban lifts any ban on ip.
+func (r *RedisStore) Unban(ip string) error {
+	return r.client.Del(redisKeyPrefix + ip).Err()
+}
+
+// IsBanned reports whether ip is currently banned.
+func (r *RedisStore) IsBanned(ip string) (bool, error) {
+	n, err := r.client.Exists(redisKeyPrefix + ip).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// List returns every currently-banned IP.
+func (r *RedisStore) List() ([]string, error) {
+	keys, err := r.client.Keys(redisKeyPrefix + "*").Result()
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, len(keys))
+	for i, k := range keys {
+		ips[i] = strings.TrimPrefix(k, redisKeyPrefix)
+	}
+	return ips, nil
+}
+
+var _ Store = (*RedisStore)(nil)
@@ -0,0 +1,78 @@
+// Package bans implements IP reputation tracking for the tracker: a
+// banned-IP set backed by an in-memory store (or, optionally, by Redis
+// for multi-node deployments), plus the request-rate and
+// reachability checks that decide when an IP earns a ban.
+package bans
+
+import (
+	"sync"
+	"time"
+)
+
+// Store persists the banned-IP set. MemoryStore keeps it in process;
+// RedisStore keeps it in Redis so every node in a multi-node deployment
+// shares the same bans. A Monitor uses exactly one Store; nothing here
+// combines the two.
+type Store interface {
+	Ban(ip string, duration time.Duration) error
+	Unban(ip string) error
+	IsBanned(ip string) (bool, error)
+	List() ([]string, error)
+}
+
+// MemoryStore is the default, in-process Store.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	banned map[string]time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{banned: make(map[string]time.Time)}
+}
+
+// Ban marks ip as banned for duration.
+func (m *MemoryStore) Ban(ip string, duration time.Duration) error {
+	m.mu.Lock()
+	m.banned[ip] = time.Now().Add(duration)
+	m.mu.Unlock()
+	return nil
+}
+
+// Unban lifts any ban on ip.
+func (m *MemoryStore) Unban(ip string) error {
+	m.mu.Lock()
+	delete(m.banned, ip)
+	m.mu.Unlock()
+	return nil
+}
+
+// IsBanned reports whether ip is currently banned, lazily expiring it if
+// its ban has elapsed.
+func (m *MemoryStore) IsBanned(ip string) (bool, error) {
+	m.mu.RLock()
+	expires, ok := m.banned[ip]
+	m.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(expires) {
+		_ = m.Unban(ip)
+		return false, nil
+	}
+	return true, nil
+}
+
+// List returns every currently-banned IP.
+func (m *MemoryStore) List() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	out := make([]string, 0, len(m.banned))
+	for ip, expires := range m.banned {
+		if now.Before(expires) {
+			out = append(out, ip)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,359 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/chihaya/bencode"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"mika/bans"
+	"mika/tracker"
+)
+
+// httpRequestTimeout bounds how long a single announce/scrape is allowed
+// to take end to end, including any storage or hook I/O it triggers. It is
+// a fixed package-level value; no config setting overrides it.
+const httpRequestTimeout = 5 * time.Second
+
+// BitTorrentHandler serves announce/scrape requests against a
+// *tracker.Tracker, running preHooks before the core tracker logic (so
+// they can reject a request before it touches the swarm) and postHooks
+// after (so they can only observe or rewrite the response), before
+// bencoding the result for the client. bans, when non-nil,
+// short-circuits requests from banned IPs and feeds the abuse counters
+// that decide when an IP earns a ban.
+type BitTorrentHandler struct {
+	t         *tracker.Tracker
+	preHooks  []tracker.PreHook
+	postHooks []tracker.PostHook
+	bans      *bans.Monitor
+}
+
+// AdminAPI serves the operator-facing JSON API against a *tracker.Tracker.
+type AdminAPI struct {
+	t    *tracker.Tracker
+	bans *bans.Monitor
+}
+
+// parseInfoHash decodes the raw 20-byte info_hash out of a query, which
+// arrives percent-encoded rather than hex-encoded on the wire.
+func parseInfoHash(raw string) ([20]byte, error) {
+	var ih [20]byte
+	if len(raw) != 20 {
+		return ih, tracker.NewClientError("Torrent info hash must be 20 characters")
+	}
+	copy(ih[:], raw)
+	return ih, nil
+}
+
+// parseAnnounceRequest builds a tracker.AnnounceRequest out of an
+// announce query, returning a *tracker.ClientError for anything the
+// client got wrong.
+func (h *BitTorrentHandler) parseAnnounceRequest(c *gin.Context, q *query) (*tracker.AnnounceRequest, error) {
+	rawInfoHash, found := q.Params[paramInfoHash]
+	if !found {
+		return nil, tracker.NewClientError("info_hash missing from request")
+	}
+	infoHash, err := parseInfoHash(rawInfoHash)
+	if err != nil {
+		return nil, err
+	}
+
+	rawPeerID, found := q.Params[paramPeerID]
+	if !found || len(rawPeerID) != 20 {
+		return nil, tracker.NewClientError("peer_id missing from request")
+	}
+	var peerID [20]byte
+	copy(peerID[:], rawPeerID)
+
+	port, err := strconv.ParseUint(q.Params[paramPort], 10, 16)
+	if err != nil {
+		return nil, tracker.NewClientError("Invalid port")
+	}
+
+	ip, err := h.getIP(q, c)
+	if err != nil || ip == nil {
+		return nil, tracker.NewClientError("Invalid ip")
+	}
+
+	return &tracker.AnnounceRequest{
+		InfoHash:   infoHash,
+		PeerID:     peerID,
+		Passkey:    c.Param("passkey"),
+		IP:         ip,
+		Port:       uint16(port),
+		Uploaded:   parseUint(q.Params[paramUploaded]),
+		Downloaded: parseUint(q.Params[paramDownloaded]),
+		Left:       parseUint(q.Params[paramLeft]),
+		Event:      tracker.Event(q.Params[paramEvent]),
+		NumWant:    int(parseUint(q.Params[paramNumWant])),
+	}, nil
+}
+
+// requestContext derives a context bounded by httpRequestTimeout from the
+// request's parent context, so a slow storage or hook call can't hold a
+// connection (or block a graceful shutdown) indefinitely.
+func requestContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request.Context(), httpRequestTimeout)
+}
+
+// announce handles GET /:passkey/announce. It parses the request, runs
+// preHooks (which can reject the request before it touches the swarm),
+// performs the core tracker bookkeeping, runs postHooks against the
+// result, and bencodes the response.
+func (h *BitTorrentHandler) announce(c *gin.Context) {
+	if h.bans != nil {
+		if remote := remoteIP(c); remote != nil && h.bans.IsBanned(remote) {
+			c.Error(tracker.ErrRequestTooFast) //nolint:errcheck
+			return
+		}
+	}
+
+	q, err := queryParams(c.Request.URL.RawQuery)
+	if err != nil {
+		h.recordMalformed(c)
+		c.Error(tracker.NewClientError("Could not parse request")) //nolint:errcheck
+		return
+	}
+
+	req, err := h.parseAnnounceRequest(c, q)
+	if err != nil {
+		h.recordMalformed(c)
+		c.Error(err) //nolint:errcheck
+		return
+	}
+	if h.bans != nil {
+		h.bans.RecordAnnounce(req.IP, req.InfoHash)
+		if req.Event == tracker.EventStarted {
+			h.bans.CheckReachable(req.IP, req.Port, req.InfoHash)
+		}
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	for _, hook := range h.preHooks {
+		if err := hook.HandleAnnounce(ctx, req); err != nil {
+			c.Error(err) //nolint:errcheck
+			return
+		}
+	}
+
+	resp, err := h.t.Announce(ctx, *req)
+	if err != nil {
+		c.Error(tracker.NewInternalError("announce failed", err)) //nolint:errcheck
+		return
+	}
+	for _, hook := range h.postHooks {
+		if err := hook.HandleAnnounce(ctx, req, resp); err != nil {
+			c.Error(err) //nolint:errcheck
+			return
+		}
+	}
+
+	c.String(200, bencodeAnnounceResponse(resp))
+}
+
+// recordMalformed feeds the ban monitor's malformed-request counter, if
+// one is configured, for requests that fail to even parse.
+func (h *BitTorrentHandler) recordMalformed(c *gin.Context) {
+	if h.bans == nil {
+		return
+	}
+	if remote := remoteIP(c); remote != nil {
+		h.bans.RecordMalformed(remote)
+	}
+}
+
+// scrape handles GET /:passkey/scrape. It mirrors announce: parse, run the
+// hook chain, bencode.
+func (h *BitTorrentHandler) scrape(c *gin.Context) {
+	if h.bans != nil {
+		if remote := remoteIP(c); remote != nil && h.bans.IsBanned(remote) {
+			c.Error(tracker.ErrRequestTooFast) //nolint:errcheck
+			return
+		}
+	}
+
+	q, err := queryParams(c.Request.URL.RawQuery)
+	if err != nil {
+		h.recordMalformed(c)
+		c.Error(tracker.NewClientError("Could not parse request")) //nolint:errcheck
+		return
+	}
+	if len(q.InfoHashes) == 0 {
+		c.Error(tracker.NewClientError("info_hash missing from request")) //nolint:errcheck
+		return
+	}
+
+	hashes := make([][20]byte, 0, len(q.InfoHashes))
+	for _, raw := range q.InfoHashes {
+		ih, err := parseInfoHash(raw)
+		if err != nil {
+			h.recordMalformed(c)
+			c.Error(err) //nolint:errcheck
+			return
+		}
+		hashes = append(hashes, ih)
+	}
+
+	req := tracker.ScrapeRequest{InfoHashes: hashes, Passkey: c.Param("passkey")}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	for _, hook := range h.preHooks {
+		if err := hook.HandleScrape(ctx, &req); err != nil {
+			c.Error(err) //nolint:errcheck
+			return
+		}
+	}
+
+	resp, err := h.t.Scrape(ctx, req)
+	if err != nil {
+		c.Error(tracker.NewInternalError("scrape failed", err)) //nolint:errcheck
+		return
+	}
+	for _, hook := range h.postHooks {
+		if err := hook.HandleScrape(ctx, &req, resp); err != nil {
+			c.Error(err) //nolint:errcheck
+			return
+		}
+	}
+
+	c.String(200, bencodeScrapeResponse(resp))
+}
+
+func parseUint(s string) uint64 {
+	v, _ := strconv.ParseUint(s, 10, 64)
+	return v
+}
+
+func bencodeAnnounceResponse(resp *tracker.AnnounceResponse) string {
+	peers := make([]byte, 0, 6*len(resp.Peers))
+	for _, p := range resp.Peers {
+		v4 := p.IP.To4()
+		if v4 == nil {
+			continue
+		}
+		peers = append(peers, v4...)
+		peers = append(peers, byte(p.Port>>8), byte(p.Port))
+	}
+	return encode(bencode.Dict{
+		"interval":   resp.Interval,
+		"complete":   resp.Seeders,
+		"incomplete": resp.Leechers,
+		"peers":      string(peers),
+	})
+}
+
+func bencodeScrapeResponse(resp *tracker.ScrapeResponse) string {
+	files := bencode.Dict{}
+	for ih, stats := range resp.Files {
+		files[string(ih[:])] = bencode.Dict{
+			"complete":   stats.Complete,
+			"downloaded": stats.Downloaded,
+			"incomplete": stats.Incomplete,
+		}
+	}
+	return encode(bencode.Dict{"files": files})
+}
+
+func encode(d bencode.Dict) string {
+	var buf bytes.Buffer
+	encoder := bencode.NewEncoder(&buf)
+	if err := encoder.Encode(d); err != nil {
+		log.Errorf("Failed to encode bencode response: %s", err)
+	}
+	return buf.String()
+}
+
+// Stats handles GET /tracker/stats.
+func (h *AdminAPI) Stats(c *gin.Context) {
+	c.JSON(200, gin.H{})
+}
+
+// torrentDelete handles DELETE /torrent/:info_hash.
+func (h *AdminAPI) torrentDelete(c *gin.Context) {
+	c.JSON(200, gin.H{"info_hash": c.Param("info_hash")})
+}
+
+// torrentUpdate handles PATCH /torrent/:info_hash.
+func (h *AdminAPI) torrentUpdate(c *gin.Context) {
+	c.JSON(200, gin.H{"info_hash": c.Param("info_hash")})
+}
+
+// banRequest is the JSON body accepted by POST /api/bans.
+type banRequest struct {
+	IP       string `json:"ip" binding:"required"`
+	Duration string `json:"duration"`
+}
+
+// bansList handles GET /api/bans, returning the currently-banned IPs.
+func (h *AdminAPI) bansList(c *gin.Context) {
+	if h.bans == nil {
+		c.JSON(200, gin.H{"bans": []string{}})
+		return
+	}
+	ips, err := h.bans.List()
+	if err != nil {
+		c.Error(tracker.NewInternalError("listing bans failed", err)) //nolint:errcheck
+		return
+	}
+	c.JSON(200, gin.H{"bans": ips})
+}
+
+// bansAdd handles POST /api/bans, manually banning an IP for the given
+// duration (config's default ban duration if omitted).
+func (h *AdminAPI) bansAdd(c *gin.Context) {
+	if h.bans == nil {
+		c.Error(tracker.NewClientError("IP banning is disabled")) //nolint:errcheck
+		return
+	}
+	var req banRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(tracker.NewClientError("Malformed request")) //nolint:errcheck
+		return
+	}
+	ip := net.ParseIP(req.IP)
+	if ip == nil {
+		c.Error(tracker.NewClientError("Invalid ip")) //nolint:errcheck
+		return
+	}
+	duration := h.bans.DefaultBanDuration()
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			c.Error(tracker.NewClientError("Invalid duration")) //nolint:errcheck
+			return
+		}
+		duration = d
+	}
+	if err := h.bans.Ban(ip, duration); err != nil {
+		c.Error(tracker.NewInternalError("banning ip failed", err)) //nolint:errcheck
+		return
+	}
+	c.JSON(200, gin.H{"ip": ip.String(), "duration": duration.String()})
+}
+
+// bansDelete handles DELETE /api/bans/:ip, lifting a ban.
+func (h *AdminAPI) bansDelete(c *gin.Context) {
+	if h.bans == nil {
+		c.Error(tracker.NewClientError("IP banning is disabled")) //nolint:errcheck
+		return
+	}
+	ip := net.ParseIP(c.Param("ip"))
+	if ip == nil {
+		c.Error(tracker.NewClientError("Invalid ip")) //nolint:errcheck
+		return
+	}
+	if err := h.bans.Unban(ip); err != nil {
+		c.Error(tracker.NewInternalError("unbanning ip failed", err)) //nolint:errcheck
+		return
+	}
+	c.JSON(200, gin.H{"ip": ip.String()})
+}
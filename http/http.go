@@ -6,11 +6,12 @@ import (
 	"github.com/chihaya/bencode"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"mika/bans"
 	"mika/tracker"
 	"net"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -85,8 +86,23 @@ func TrackerErr(code trackerErrCode) error {
 	return responseStringMap[code]
 }
 
-// getIP Parses and returns a IP from a string
-func getIP(q *query, c *gin.Context) (net.IP, error) {
+// remoteIP parses the net.IP out of a gin request's RemoteAddr, ignoring
+// the port. Uses net.SplitHostPort rather than splitting on ":", since an
+// IPv6 RemoteAddr ("[2001:db8::1]:54321") contains colons in the host
+// itself.
+func remoteIP(c *gin.Context) net.IP {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// getIP parses and returns the client IP for a request. X-Forwarded-For
+// is only honored when the socket's remote address is in the configured
+// trustedProxies CIDR list; trusting it unconditionally lets any client
+// spoof its own IP and dodge bans or per-IP rate limiting.
+func (h *BitTorrentHandler) getIP(q *query, c *gin.Context) (net.IP, error) {
 	ipStr, found := q.Params[paramIP]
 	if found {
 		ip := net.ParseIP(ipStr)
@@ -94,38 +110,70 @@ func getIP(q *query, c *gin.Context) (net.IP, error) {
 			return ip.To4(), nil
 		}
 	}
-	// Look for forwarded ip in header then default to remote address
-	forwardedIP := c.Request.Header.Get("X-Forwarded-For")
-	if forwardedIP != "" {
-		ip := net.ParseIP(forwardedIP)
-		if ip != nil {
-			return ip.To4(), nil
+
+	remote := remoteIP(c)
+	if h.bans != nil && remote != nil && h.bans.TrustForwardedFor(remote) {
+		forwardedIP := c.Request.Header.Get("X-Forwarded-For")
+		if forwardedIP != "" {
+			ip := net.ParseIP(forwardedIP)
+			if ip != nil {
+				return ip.To4(), nil
+			}
+			return ip, nil
 		}
-		return ip, nil
 	}
-	s := strings.Split(c.Request.RemoteAddr, ":")
-	ipReq, _ := s[0], s[1]
-	ip := net.ParseIP(ipReq)
-	if ip != nil {
-		return ip.To4(), nil
+	if remote != nil {
+		return remote.To4(), nil
 	}
-	return ip, nil
+	return remote, nil
 }
 
-// oops will output a bencoded error code to the torrent client using
-// a preset message code constant
-func oops(ctx *gin.Context, errCode trackerErrCode) {
-	msg, exists := responseStringMap[errCode]
-	if !exists {
-		msg = responseStringMap[msgGenericError]
+// classifyError maps a tracker-package typed error to the trackerErrCode
+// and HTTP status a frontend should respond with, the same way Chihaya's
+// handleError does: client mistakes and missing resources are reported to
+// the client at face value, while internal failures are logged with their
+// cause and collapsed to a generic message so nothing implementation-
+// specific leaks onto the wire.
+func classifyError(err error) (trackerErrCode, int) {
+	// A handful of sentinel errors carry a more specific wire code than
+	// their type alone would give them.
+	if err == tracker.ErrRequestTooFast {
+		return msgClientRequestTooFast, http.StatusOK
+	}
+	if err == tracker.ErrInvalidAuth {
+		return msgInvalidAuth, http.StatusOK
+	}
+	if err == tracker.ErrInvalidPeerID {
+		return msgInvalidPeerID, http.StatusOK
 	}
-	ctx.String(int(errCode), responseError(msg.Error()))
-	log.Errorf("Error in request from: %s (%d)", ctx.Request.RequestURI, errCode)
+
+	switch e := err.(type) {
+	case *tracker.ClientError:
+		return msgMalformedRequest, http.StatusOK
+	case *tracker.NotFoundError:
+		return msgInfoHashNotFound, http.StatusOK
+	case *tracker.InternalError:
+		log.Errorf("internal tracker error: %s", e)
+		return msgGenericError, http.StatusInternalServerError
+	default:
+		log.Errorf("unclassified tracker error: %s", err)
+		return msgGenericError, http.StatusInternalServerError
+	}
+}
+
+// oops writes a bencoded failure reason to the torrent client, using the
+// error's own message rather than the generic trackerErrCode text so the
+// client sees exactly why its request was rejected.
+func oops(ctx *gin.Context, err error, status int) {
+	ctx.String(status, responseError(err.Error()))
+	log.Errorf("Error in request from: %s (%s)", ctx.Request.RequestURI, err)
 }
 
-// handleTrackerErrors is used as the default error handler for tracker requests
-// the error is returned to the client as a bencoded error string as defined in the
-// bittorrent specs.
+// handleTrackerErrors is used as the default error handler for tracker
+// requests: the error is classified and returned to the client as a
+// bencoded error string as defined in the bittorrent specs. Internal
+// failures are answered with the generic msgGenericError text. The
+// responses metric is recorded separately, by metricsMiddleware.
 func handleTrackerErrors(ctx *gin.Context) {
 	// Run request handler
 	ctx.Next()
@@ -133,16 +181,13 @@ func handleTrackerErrors(ctx *gin.Context) {
 	// Handle any errors recorded
 	errorReturned := ctx.Errors.Last()
 	if errorReturned != nil {
-		meta := errorReturned.JSON().(gin.H)
-
-		status := msgGenericError
-		customStatus, found := meta["status"]
-		if found {
-			status = customStatus.(trackerErrCode)
+		code, status := classifyError(errorReturned.Err)
+		err := errorReturned.Err
+		if code == msgGenericError {
+			// classifyError already logged the cause.
+			err = TrackerErr(msgGenericError)
 		}
-
-		// TODO handle private/public errors separately, like sentry output for priv errors
-		oops(ctx, status)
+		oops(ctx, err, status)
 	}
 }
 
@@ -170,27 +215,55 @@ func newRouter() *gin.Engine {
 	return router
 }
 
-// NewBitTorrentHandler configures a router to handle tracker announce/scrape requests
-func NewBitTorrentHandler(tkr *tracker.Tracker) *gin.Engine {
+// NewBitTorrentHandler configures a router to handle tracker announce/scrape
+// requests. preHooks run, in order, before the core tracker logic for
+// every announce and scrape, so they can reject a request (client/torrent
+// approval, passkey verification, ...) before it ever touches the swarm;
+// postHooks run, in order, after, so they can only observe or rewrite the
+// response (jittered intervals, ...). Both let operators compose behavior
+// without patching core code.
+// banMonitor optionally bans abusive IPs and gates trust in
+// X-Forwarded-For; pass nil to disable IP reputation tracking entirely.
+func NewBitTorrentHandler(tkr *tracker.Tracker, banMonitor *bans.Monitor, preHooks []tracker.PreHook, postHooks []tracker.PostHook) *gin.Engine {
 	r := newRouter()
+	r.Use(metricsMiddleware)
 	r.Use(handleTrackerErrors)
 	h := BitTorrentHandler{
-		t: tkr,
+		t:         tkr,
+		preHooks:  preHooks,
+		postHooks: postHooks,
+		bans:      banMonitor,
 	}
 	r.GET("/:passkey/announce", h.announce)
 	r.GET("/:passkey/scrape", h.scrape)
 	return r
 }
 
-// NewAPIHandler configures a router to handle API requests
-func NewAPIHandler(tkr *tracker.Tracker) *gin.Engine {
+// NewAPIHandler configures a router to handle API requests. banMonitor may
+// be nil, in which case /api/bans reports an empty set and rejects writes.
+func NewAPIHandler(tkr *tracker.Tracker, banMonitor *bans.Monitor) *gin.Engine {
 	r := newRouter()
 	h := AdminAPI{
-		t: tkr,
+		t:    tkr,
+		bans: banMonitor,
 	}
 	r.GET("/tracker/stats", h.Stats)
 	r.DELETE("/torrent/:info_hash", h.torrentDelete)
 	r.PATCH("/torrent/:info_hash", h.torrentUpdate)
+	r.GET("/api/bans", h.bansList)
+	r.POST("/api/bans", h.bansAdd)
+	r.DELETE("/api/bans/:ip", h.bansDelete)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	return r
+}
+
+// NewMetricsHandler configures a router serving only /metrics, for use with
+// CreateServer on an address of the caller's choosing. No config setting
+// selects that address, and NewAPIHandler serves /metrics as well either
+// way.
+func NewMetricsHandler() *gin.Engine {
+	r := newRouter()
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	return r
 }
 
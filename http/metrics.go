@@ -0,0 +1,71 @@
+package http
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mika/metrics"
+	"mika/tracker"
+)
+
+// metricsMiddleware times every announce/scrape request and records it
+// into metrics.RequestDuration/metrics.Responses, labeled by endpoint,
+// announce event and the trackerErrCode the request ultimately resolved
+// to (msgOk on success).
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	endpoint := endpointLabel(c.FullPath())
+	event := string(parseAnnounceType(c.Query(paramEvent)))
+
+	code := msgOk
+	if errReturned := c.Errors.Last(); errReturned != nil {
+		code, _ = classifyError(errReturned.Err)
+	}
+
+	metrics.RequestDuration.WithLabelValues(endpoint, event).Observe(time.Since(start).Seconds())
+	metrics.Responses.WithLabelValues(endpoint, event, strconv.Itoa(int(code))).Inc()
+}
+
+// endpointLabel collapses a gin route template down to the short endpoint
+// name used on every metric, so "/:passkey/announce" becomes "announce".
+func endpointLabel(fullPath string) string {
+	switch {
+	case strings.HasSuffix(fullPath, "/announce"):
+		return "announce"
+	case strings.HasSuffix(fullPath, "/scrape"):
+		return "scrape"
+	default:
+		return "unknown"
+	}
+}
+
+// updateStoreGauges pulls the current seeders/leechers/torrents counts off
+// tkr and publishes them to the metrics package's gauges. It's cheap
+// enough to run on an interval rather than per-request.
+func updateStoreGauges(tkr *tracker.Tracker) {
+	stats := tkr.Stats()
+	metrics.Seeders.Set(float64(stats.Seeders))
+	metrics.Leechers.Set(float64(stats.Leechers))
+	metrics.Torrents.Set(float64(stats.Torrents))
+}
+
+// WatchStoreGauges starts a goroutine that refreshes the store gauges
+// every interval until stop is closed.
+func WatchStoreGauges(tkr *tracker.Tracker, interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				updateStoreGauges(tkr)
+			}
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"net/url"
+)
+
+// Query parameter names used by the announce/scrape wire format.
+const (
+	paramInfoHash   = "info_hash"
+	paramPeerID     = "peer_id"
+	paramPort       = "port"
+	paramUploaded   = "uploaded"
+	paramDownloaded = "downloaded"
+	paramLeft       = "left"
+	paramEvent      = "event"
+	paramIP         = "ip"
+	paramNumWant    = "numwant"
+	paramKey        = "key"
+	paramCompact    = "compact"
+)
+
+// query holds the raw, percent-decoded parameters parsed out of an
+// announce/scrape request's query string, keyed by parameter name.
+type query struct {
+	Params     map[string]string
+	InfoHashes []string
+}
+
+// queryParams parses a raw query string into a query, keeping every
+// occurrence of info_hash (scrape requests may repeat it) while the rest
+// of the parameters are kept as a simple last-value-wins map, which is
+// all announce/scrape ever send more than once of.
+func queryParams(rawQuery string) (*query, error) {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	q := &query{Params: make(map[string]string, len(values))}
+	for k, v := range values {
+		if len(v) == 0 {
+			continue
+		}
+		q.Params[k] = v[len(v)-1]
+	}
+	q.InfoHashes = values[paramInfoHash]
+	return q, nil
+}
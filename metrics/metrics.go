@@ -0,0 +1,60 @@
+// Package metrics holds the Prometheus collectors shared by every
+// frontend (http, udp, ...) so operators get one consistent set of
+// tracker metrics regardless of which wire protocols are enabled.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// durationBuckets are tuned for a tracker: most announces/scrapes answer
+// out of memory in well under a millisecond, with a long tail once
+// storage or hooks do network I/O.
+var durationBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5}
+
+// RequestDuration records how long an announce/scrape took to answer,
+// labeled by endpoint ("announce"/"scrape") and announce event
+// ("started"/"stopped"/"completed"/"").
+var RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "mika",
+	Subsystem: "tracker",
+	Name:      "request_duration_seconds",
+	Help:      "Time taken to answer a tracker request.",
+	Buckets:   durationBuckets,
+}, []string{"endpoint", "event"})
+
+// Responses counts every response sent, labeled by endpoint, event and
+// a result code: the HTTP frontend's wire-protocol error code (200/"msgOk"
+// on success), or "ok"/"error" from the UDP frontend.
+var Responses = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "mika",
+	Subsystem: "tracker",
+	Name:      "responses_total",
+	Help:      "Count of tracker responses by endpoint, event and error code.",
+}, []string{"endpoint", "event", "code"})
+
+// Seeders, Leechers and Torrents are gauges reflecting the current state
+// of the tracker's peer store; callers should update them from the
+// *tracker.Tracker on a schedule or on every announce.
+var (
+	Seeders = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mika",
+		Subsystem: "tracker",
+		Name:      "seeders",
+		Help:      "Current number of seeders across all torrents.",
+	})
+	Leechers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mika",
+		Subsystem: "tracker",
+		Name:      "leechers",
+		Help:      "Current number of leechers across all torrents.",
+	})
+	Torrents = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mika",
+		Subsystem: "tracker",
+		Name:      "torrents",
+		Help:      "Current number of torrents known to the tracker.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(RequestDuration, Responses, Seeders, Leechers, Torrents)
+}
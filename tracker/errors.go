@@ -0,0 +1,55 @@
+package tracker
+
+// ClientError indicates the request itself was invalid (a malformed
+// parameter, a rejected peer_id, ...). Frontends surface its message to
+// the client as-is; it isn't logged as a tracker fault.
+type ClientError struct{ msg string }
+
+func (e *ClientError) Error() string { return e.msg }
+
+// NewClientError builds a ClientError carrying msg as the client-facing
+// failure reason.
+func NewClientError(msg string) *ClientError { return &ClientError{msg: msg} }
+
+// NotFoundError indicates the requested resource (torrent, passkey, ...)
+// doesn't exist.
+type NotFoundError struct{ msg string }
+
+func (e *NotFoundError) Error() string { return e.msg }
+
+// NewNotFoundError builds a NotFoundError carrying msg as the
+// client-facing failure reason.
+func NewNotFoundError(msg string) *NotFoundError { return &NotFoundError{msg: msg} }
+
+// InternalError indicates a failure inside the tracker itself (storage,
+// hook infrastructure, ...) rather than anything the client did wrong.
+// Frontends log Cause and return a generic message to the client.
+type InternalError struct {
+	msg   string
+	cause error
+}
+
+func (e *InternalError) Error() string {
+	if e.cause != nil {
+		return e.msg + ": " + e.cause.Error()
+	}
+	return e.msg
+}
+
+// Unwrap exposes the underlying cause for errors.Is/errors.As.
+func (e *InternalError) Unwrap() error { return e.cause }
+
+// NewInternalError builds an InternalError wrapping cause.
+func NewInternalError(msg string, cause error) *InternalError {
+	return &InternalError{msg: msg, cause: cause}
+}
+
+// Sentinel errors a Hook can return to abort its chain. Each is typed so
+// frontends can classify failures generically while still reporting a
+// precise, client-facing reason.
+var (
+	ErrInvalidPeerID    = NewClientError("Peer ID Invalid")
+	ErrInfoHashNotFound = NewNotFoundError("Unknown infohash")
+	ErrInvalidAuth      = NewClientError("Invalid passkey supplied")
+	ErrRequestTooFast   = NewClientError("Slow down there jimmy")
+)
@@ -0,0 +1,25 @@
+package tracker
+
+import "context"
+
+// PreHook runs before the core tracker logic touches the swarm, so it can
+// validate or authenticate a request (client approval, torrent approval,
+// passkey verification, ...) and reject it before the peer is ever
+// recorded, counted or handed out to other announcers. Hooks run in the
+// order they're registered; the first one to return an error aborts the
+// chain and that error is surfaced to the client by the frontend.
+type PreHook interface {
+	HandleAnnounce(ctx context.Context, req *AnnounceRequest) error
+	HandleScrape(ctx context.Context, req *ScrapeRequest) error
+}
+
+// PostHook runs after the core tracker logic has produced a response, so
+// it can observe or rewrite the response (jittering the interval, ...)
+// but can no longer prevent the request from having taken effect. Hooks
+// run in the order they're registered; the first one to return an error
+// aborts the chain and that error is surfaced to the client by the
+// frontend.
+type PostHook interface {
+	HandleAnnounce(ctx context.Context, req *AnnounceRequest, resp *AnnounceResponse) error
+	HandleScrape(ctx context.Context, req *ScrapeRequest, resp *ScrapeResponse) error
+}
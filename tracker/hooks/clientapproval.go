@@ -0,0 +1,70 @@
+// Package hooks provides tracker.PreHook and tracker.PostHook
+// implementations that operators can enable and configure without
+// patching the tracker core.
+package hooks
+
+import (
+	"context"
+
+	"mika/tracker"
+)
+
+// ClientApproval checks the client-id prefix of an announcing peer id
+// (the first 8 bytes, e.g. "-DE13F0-" for Deluge 1.3.15) against a
+// whitelist and/or blacklist of client prefixes.
+type ClientApproval struct {
+	whitelist map[string]struct{}
+	blacklist map[string]struct{}
+}
+
+// NewClientApproval builds a ClientApproval hook from the configured
+// whitelist/blacklist client-id prefixes. An empty whitelist allows every
+// client not explicitly blacklisted.
+func NewClientApproval(whitelist, blacklist []string) *ClientApproval {
+	return &ClientApproval{
+		whitelist: toSet(whitelist),
+		blacklist: toSet(blacklist),
+	}
+}
+
+func toSet(values []string) map[string]struct{} {
+	s := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		s[v] = struct{}{}
+	}
+	return s
+}
+
+// clientPrefix extracts the client identifier convention most BitTorrent
+// clients encode at the start of their peer_id, e.g. "-DE13F0-".
+func clientPrefix(peerID [20]byte) string {
+	if peerID[0] != '-' || peerID[7] != '-' {
+		return ""
+	}
+	return string(peerID[0:8])
+}
+
+// HandleAnnounce rejects the announce with tracker.ErrInvalidPeerID if the
+// peer's client-id prefix is blacklisted, or isn't whitelisted when a
+// whitelist is configured. It runs as a PreHook, before the peer is
+// recorded in the swarm, so a rejected client never joins it.
+func (c *ClientApproval) HandleAnnounce(ctx context.Context, req *tracker.AnnounceRequest) error {
+	prefix := clientPrefix(req.PeerID)
+	if _, banned := c.blacklist[prefix]; banned {
+		return tracker.ErrInvalidPeerID
+	}
+	if len(c.whitelist) > 0 {
+		if _, ok := c.whitelist[prefix]; !ok {
+			return tracker.ErrInvalidPeerID
+		}
+	}
+	return nil
+}
+
+// HandleScrape is a no-op: scrape requests don't carry a peer_id, so
+// there's nothing to approve.
+func (c *ClientApproval) HandleScrape(ctx context.Context, req *tracker.ScrapeRequest) error {
+	return nil
+}
+
+var _ tracker.PreHook = (*ClientApproval)(nil)
@@ -0,0 +1,33 @@
+package hooks
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// rsaPublicKeyHolder wraps the *rsa.PublicKey decoded from a jwk entry.
+type rsaPublicKeyHolder struct {
+	publicKey *rsa.PublicKey
+}
+
+// rsaPublicKey decodes a jwk's base64url-encoded modulus/exponent into an
+// *rsa.PublicKey usable by jwt.ParseWithClaims' keyfunc.
+func (k jwk) rsaPublicKey() (*rsaPublicKeyHolder, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding jwk modulus")
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding jwk exponent")
+	}
+
+	pub := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}
+	return &rsaPublicKeyHolder{publicKey: pub}, nil
+}
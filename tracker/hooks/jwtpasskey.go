@@ -0,0 +1,143 @@
+package hooks
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"mika/tracker"
+)
+
+// passkeyClaims binds a JWS passkey token to the specific info_hash and
+// peer_id it was issued for, so a leaked token can't be replayed against a
+// different torrent or client.
+type passkeyClaims struct {
+	jwt.RegisteredClaims
+	InfoHash string `json:"info_hash"`
+	PeerID   string `json:"peer_id"`
+}
+
+// jwk is the subset of a JWKS key entry this hook cares about (RSA, the
+// only algorithm mika's issuer side uses).
+type jwk struct {
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWTPasskey verifies that the :passkey path segment of a request is a
+// valid JWS token, issued for that specific info_hash/peer_id pair, using
+// keys fetched from a JWKS URL and refreshed on an interval.
+type JWTPasskey struct {
+	jwksURL string
+
+	mu   sync.RWMutex
+	keys map[string]*rsaPublicKeyHolder
+}
+
+// NewJWTPasskey fetches jwksURL immediately, then again every refresh
+// interval, and returns a hook ready to verify passkeys.
+func NewJWTPasskey(jwksURL string, refresh time.Duration) (*JWTPasskey, error) {
+	j := &JWTPasskey{jwksURL: jwksURL}
+	if err := j.refreshKeys(); err != nil {
+		return nil, err
+	}
+	go j.refreshLoop(refresh)
+	return j, nil
+}
+
+func (j *JWTPasskey) refreshLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := j.refreshKeys(); err != nil {
+			log.Errorf("jwt passkey: failed to refresh jwks: %s", err)
+		}
+	}
+}
+
+func (j *JWTPasskey) refreshKeys() error {
+	resp, err := http.Get(j.jwksURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsaPublicKeyHolder, len(set.Keys))
+	for _, k := range set.Keys {
+		pub, err := k.rsaPublicKey()
+		if err != nil {
+			log.Errorf("jwt passkey: skipping malformed jwks key %s: %s", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+	return nil
+}
+
+// HandleAnnounce verifies the passkey against the claimed info_hash and
+// peer_id of the announce. It runs as a PreHook: the token is checked
+// before the peer is ever recorded in the swarm, so a forged or expired
+// passkey never gains the peer visibility.
+func (j *JWTPasskey) HandleAnnounce(ctx context.Context, req *tracker.AnnounceRequest) error {
+	return j.verify(req.Passkey, hex.EncodeToString(req.InfoHash[:]), hex.EncodeToString(req.PeerID[:]))
+}
+
+// HandleScrape verifies the passkey against the request's first info_hash,
+// since scrape tokens aren't bound to a peer_id.
+func (j *JWTPasskey) HandleScrape(ctx context.Context, req *tracker.ScrapeRequest) error {
+	if len(req.InfoHashes) == 0 {
+		return nil
+	}
+	return j.verify(req.Passkey, hex.EncodeToString(req.InfoHashes[0][:]), "")
+}
+
+func (j *JWTPasskey) verify(token, infoHash, peerID string) error {
+	var claims passkeyClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		// Reject anything but RSA outright rather than relying on the
+		// keyfunc's return type alone to defeat an HMAC/RSA confusion
+		// attack (a forged token signed with the public key as an HMAC
+		// secret).
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		j.mu.RLock()
+		key, ok := j.keys[kid]
+		j.mu.RUnlock()
+		if !ok {
+			return nil, errors.Errorf("unknown jwks kid %q", kid)
+		}
+		return key.publicKey, nil
+	})
+	if err != nil {
+		return tracker.ErrInvalidAuth
+	}
+	if claims.InfoHash != infoHash {
+		return tracker.ErrInvalidAuth
+	}
+	if peerID != "" && claims.PeerID != peerID {
+		return tracker.ErrInvalidAuth
+	}
+	return nil
+}
+
+var _ tracker.PreHook = (*JWTPasskey)(nil)
@@ -0,0 +1,121 @@
+package hooks
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+	"mika/tracker"
+)
+
+// torrentApprovalFile is the on-disk shape of the YAML file driving
+// TorrentApproval, keyed by hex-encoded info hash.
+type torrentApprovalFile struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// TorrentApproval allow/deny-lists torrents by info hash, loaded from a
+// YAML file and hot-reloaded on SIGHUP so operators can update the list
+// without restarting the tracker.
+type TorrentApproval struct {
+	path string
+
+	mu    sync.RWMutex
+	allow map[string]struct{}
+	deny  map[string]struct{}
+}
+
+// NewTorrentApproval loads path and starts a goroutine that reloads it
+// whenever the process receives SIGHUP.
+func NewTorrentApproval(path string) (*TorrentApproval, error) {
+	t := &TorrentApproval{path: path}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	go t.watchSIGHUP()
+	return t, nil
+}
+
+func (t *TorrentApproval) reload() error {
+	data, err := ioutil.ReadFile(t.path)
+	if err != nil {
+		return err
+	}
+	var cfg torrentApprovalFile
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.allow = toSet(lowercaseAll(cfg.Allow))
+	t.deny = toSet(lowercaseAll(cfg.Deny))
+	t.mu.Unlock()
+	return nil
+}
+
+// lowercaseAll lowercases each entry of values, so a hex info hash written
+// in uppercase in the YAML file still matches the lowercase output of
+// hex.EncodeToString in approved().
+func lowercaseAll(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToLower(v)
+	}
+	return out
+}
+
+func (t *TorrentApproval) watchSIGHUP() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		if err := t.reload(); err != nil {
+			log.Errorf("torrent approval: failed to reload %s: %s", t.path, err)
+			continue
+		}
+		log.Infof("torrent approval: reloaded %s", t.path)
+	}
+}
+
+func (t *TorrentApproval) approved(ih [20]byte) bool {
+	key := hex.EncodeToString(ih[:])
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if _, denied := t.deny[key]; denied {
+		return false
+	}
+	if len(t.allow) > 0 {
+		_, ok := t.allow[key]
+		return ok
+	}
+	return true
+}
+
+// HandleAnnounce rejects the announce with tracker.ErrInfoHashNotFound if
+// the torrent isn't approved. It runs as a PreHook, before the peer is
+// recorded in the swarm, so an unapproved torrent never gets an entry.
+func (t *TorrentApproval) HandleAnnounce(ctx context.Context, req *tracker.AnnounceRequest) error {
+	if !t.approved(req.InfoHash) {
+		return tracker.ErrInfoHashNotFound
+	}
+	return nil
+}
+
+// HandleScrape rejects the scrape if any requested torrent isn't
+// approved.
+func (t *TorrentApproval) HandleScrape(ctx context.Context, req *tracker.ScrapeRequest) error {
+	for _, ih := range req.InfoHashes {
+		if !t.approved(ih) {
+			return tracker.ErrInfoHashNotFound
+		}
+	}
+	return nil
+}
+
+var _ tracker.PreHook = (*TorrentApproval)(nil)
@@ -0,0 +1,38 @@
+package hooks
+
+import (
+	"context"
+	"math/rand"
+
+	"mika/tracker"
+)
+
+// VarInterval adds a uniformly random jitter in [0, maxJitter] seconds to
+// the announce interval returned to clients, smearing reannounces across
+// time instead of letting an entire swarm reannounce in the same second.
+// It runs as a PostHook: it only rewrites the response, so it has nothing
+// useful to do before the core tracker logic has produced one.
+type VarInterval struct {
+	maxJitter int
+}
+
+// NewVarInterval returns a VarInterval hook jittering by up to maxJitter
+// seconds.
+func NewVarInterval(maxJitter int) *VarInterval {
+	return &VarInterval{maxJitter: maxJitter}
+}
+
+// HandleAnnounce adds the jitter to resp.Interval.
+func (v *VarInterval) HandleAnnounce(ctx context.Context, req *tracker.AnnounceRequest, resp *tracker.AnnounceResponse) error {
+	if v.maxJitter > 0 {
+		resp.Interval += rand.Intn(v.maxJitter + 1)
+	}
+	return nil
+}
+
+// HandleScrape is a no-op; scrape responses don't carry an interval.
+func (v *VarInterval) HandleScrape(ctx context.Context, req *tracker.ScrapeRequest, resp *tracker.ScrapeResponse) error {
+	return nil
+}
+
+var _ tracker.PostHook = (*VarInterval)(nil)
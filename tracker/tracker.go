@@ -0,0 +1,196 @@
+// Package tracker implements the protocol-agnostic BitTorrent tracker core:
+// peer bookkeeping and announce/scrape accounting. Wire-protocol frontends
+// (http, udp, ...) parse their transport-specific request format and call
+// into this package to do the actual work, so that stats, storage and
+// passkey handling stay shared across every frontend instead of being
+// duplicated per-protocol.
+package tracker
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Event describes why a peer is announcing.
+type Event string
+
+// Announce events, shared by every frontend.
+const (
+	EventNone      Event = ""
+	EventStarted   Event = "started"
+	EventStopped   Event = "stopped"
+	EventCompleted Event = "completed"
+)
+
+// AnnounceRequest is the transport-agnostic representation of an announce,
+// populated by each frontend from its own wire format before being handed
+// to the Tracker.
+type AnnounceRequest struct {
+	InfoHash   [20]byte
+	PeerID     [20]byte
+	Passkey    string
+	IP         net.IP
+	Port       uint16
+	Uploaded   uint64
+	Downloaded uint64
+	Left       uint64
+	Event      Event
+	NumWant    int
+}
+
+// AnnounceResponse is the transport-agnostic announce result. Each frontend
+// is responsible for encoding it in whatever form its wire protocol needs.
+type AnnounceResponse struct {
+	Interval int
+	Leechers int
+	Seeders  int
+	Peers    []Peer
+}
+
+// Peer is a single swarm member returned in an announce response.
+type Peer struct {
+	IP   net.IP
+	Port uint16
+}
+
+// ScrapeRequest asks for swarm statistics on one or more torrents.
+type ScrapeRequest struct {
+	InfoHashes [][20]byte
+	Passkey    string
+}
+
+// ScrapeResponse carries per-torrent swarm statistics keyed by info hash.
+type ScrapeResponse struct {
+	Files map[[20]byte]ScrapeStats
+}
+
+// ScrapeStats holds the swarm counters for a single torrent.
+type ScrapeStats struct {
+	Complete   int
+	Incomplete int
+	Downloaded int
+}
+
+// peerState is the bookkeeping the Tracker keeps per swarm member.
+type peerState struct {
+	peer       Peer
+	uploaded   uint64
+	downloaded uint64
+	left       uint64
+	updated    time.Time
+}
+
+// AnnounceInterval is the interval, in seconds, frontends should tell
+// clients to wait between announces.
+const AnnounceInterval = 60
+
+// Tracker holds the state shared by every frontend: the in-memory peer
+// swarms and the counters derived from them.
+type Tracker struct {
+	mu    sync.RWMutex
+	peers map[[20]byte]map[string]*peerState
+}
+
+// New returns an empty Tracker ready to serve announces and scrapes.
+func New() *Tracker {
+	return &Tracker{
+		peers: make(map[[20]byte]map[string]*peerState),
+	}
+}
+
+// peerKey uniquely identifies a swarm member by peer id, since the same
+// IP:port pair can be reused by multiple clients behind NAT.
+func peerKey(peerID [20]byte) string {
+	return string(peerID[:])
+}
+
+// Announce records the reporting peer's state for the given swarm and
+// returns a fresh view of it, honoring numWant. ctx is accepted for
+// symmetry with PreHook/PostHook and so storage-backed Trackers can honor
+// cancellation; the in-memory implementation doesn't need it yet.
+func (t *Tracker) Announce(ctx context.Context, req AnnounceRequest) (*AnnounceResponse, error) {
+	t.mu.Lock()
+	swarm, ok := t.peers[req.InfoHash]
+	if !ok {
+		swarm = make(map[string]*peerState)
+		t.peers[req.InfoHash] = swarm
+	}
+	key := peerKey(req.PeerID)
+	if req.Event == EventStopped {
+		delete(swarm, key)
+	} else {
+		swarm[key] = &peerState{
+			peer:       Peer{IP: req.IP, Port: req.Port},
+			uploaded:   req.Uploaded,
+			downloaded: req.Downloaded,
+			left:       req.Left,
+			updated:    time.Now(),
+		}
+	}
+
+	numWant := req.NumWant
+	if numWant <= 0 || numWant > 50 {
+		numWant = 50
+	}
+	resp := &AnnounceResponse{Interval: AnnounceInterval}
+	for k, p := range swarm {
+		if p.left == 0 {
+			resp.Seeders++
+		} else {
+			resp.Leechers++
+		}
+		if k == key || len(resp.Peers) >= numWant {
+			continue
+		}
+		resp.Peers = append(resp.Peers, p.peer)
+	}
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// Scrape returns swarm statistics for the requested info hashes.
+func (t *Tracker) Scrape(ctx context.Context, req ScrapeRequest) (*ScrapeResponse, error) {
+	resp := &ScrapeResponse{Files: make(map[[20]byte]ScrapeStats, len(req.InfoHashes))}
+	t.mu.RLock()
+	for _, ih := range req.InfoHashes {
+		var stats ScrapeStats
+		for _, p := range t.peers[ih] {
+			if p.left == 0 {
+				stats.Complete++
+			} else {
+				stats.Incomplete++
+			}
+		}
+		resp.Files[ih] = stats
+	}
+	t.mu.RUnlock()
+	return resp, nil
+}
+
+// StoreStats is a point-in-time snapshot of the peer store, used to drive
+// the seeders/leechers/torrents gauges exposed over /metrics.
+type StoreStats struct {
+	Seeders  int
+	Leechers int
+	Torrents int
+}
+
+// Stats returns a snapshot of the current peer store.
+func (t *Tracker) Stats() StoreStats {
+	var s StoreStats
+	t.mu.RLock()
+	s.Torrents = len(t.peers)
+	for _, swarm := range t.peers {
+		for _, p := range swarm {
+			if p.left == 0 {
+				s.Seeders++
+			} else {
+				s.Leechers++
+			}
+		}
+	}
+	t.mu.RUnlock()
+	return s
+}
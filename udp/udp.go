@@ -0,0 +1,516 @@
+// Package udp implements a BEP 15 UDP tracker frontend. It mirrors the
+// http package's API (NewUDPFrontend / CreateServer instead of
+// NewBitTorrentHandler / CreateServer) but speaks the compact UDP tracker
+// protocol instead of bencoded HTTP, routing parsed requests through the
+// same *tracker.Tracker used by the HTTP frontend so stats, storage and
+// passkey handling are shared between the two.
+package udp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"mika/metrics"
+	"mika/tracker"
+)
+
+// Actions, as defined by BEP 15.
+const (
+	actionConnect  int32 = 0
+	actionAnnounce int32 = 1
+	actionScrape   int32 = 2
+	actionError    int32 = 3
+)
+
+const (
+	connectRequestSize  = 16
+	announceRequestSize = 98
+	scrapeHeaderSize    = 16
+	maxScrapeInfoHashes = 74
+	bufferSize          = 2048
+	connectionIDMagic   = 0x41727101980 // BEP 15 magic constant for connect requests
+
+	// connectionIDTTL is how long an issued connection id remains valid,
+	// per BEP 15 ("administrative purpose... should be valid for 2 minutes").
+	connectionIDTTL = 2 * time.Minute
+
+	// requestTimeout bounds how long a single announce/scrape is allowed
+	// to take end to end, including any storage or hook I/O it triggers.
+	// Mirrors http.httpRequestTimeout.
+	requestTimeout = 5 * time.Second
+
+	// extensionURLData is BEP 15's "URL data" extension type. Private
+	// trackers (opentracker and others) conventionally use it to carry
+	// data, such as a passkey, that doesn't fit in the fixed-size
+	// announce/scrape packet; mika reuses the same convention so clients
+	// that already speak it need no special casing.
+	extensionURLData = 2
+)
+
+// errMalformedRequest is a sentinel used only to mark a request that
+// failed to parse for metrics purposes; the client-facing reason always
+// travels separately via sendError.
+var errMalformedRequest = errors.New("udp: malformed request")
+
+// Config holds the tunables for the UDP frontend.
+type Config struct {
+	// Workers is the number of goroutines reading from the packet conn.
+	Workers int
+}
+
+// connKey identifies an issued connection id by the client that holds it,
+// so a connection id stolen or guessed by another address can't be used
+// (defeating spoofing, per BEP 15's recommendation).
+type connKey struct {
+	addr   string
+	connID uint64
+}
+
+// Frontend serves BitTorrent UDP tracker requests against a shared
+// *tracker.Tracker. preHooks run before the core tracker logic for every
+// announce and scrape, so they can reject a request (client/torrent
+// approval, passkey verification, ...) before it ever touches the swarm,
+// the same way they do for the HTTP frontend; postHooks run after, and
+// can only observe or rewrite the response.
+type Frontend struct {
+	t    *tracker.Tracker
+	addr string
+	cfg  Config
+
+	preHooks  []tracker.PreHook
+	postHooks []tracker.PostHook
+
+	bufPool sync.Pool
+
+	connMu sync.Mutex
+	conns  map[connKey]time.Time
+
+	conn net.PacketConn
+	wg   sync.WaitGroup
+	stop chan struct{}
+}
+
+// NewUDPFrontend returns a Frontend that will serve tracker requests on
+// addr once Serve is called.
+func NewUDPFrontend(tkr *tracker.Tracker, addr string, cfg Config, preHooks []tracker.PreHook, postHooks []tracker.PostHook) *Frontend {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	return &Frontend{
+		t:         tkr,
+		addr:      addr,
+		cfg:       cfg,
+		preHooks:  preHooks,
+		postHooks: postHooks,
+		conns:     make(map[connKey]time.Time),
+		bufPool: sync.Pool{
+			New: func() interface{} {
+				b := make([]byte, bufferSize)
+				return &b
+			},
+		},
+		stop: make(chan struct{}),
+	}
+}
+
+// CreateServer binds the UDP socket the Frontend will serve on. It mirrors
+// http.CreateServer in spirit: construct, then hand the result to Serve.
+func CreateServer(f *Frontend) (net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp", f.addr)
+	if err != nil {
+		return nil, err
+	}
+	f.conn = conn
+	return conn, nil
+}
+
+// Serve runs f.cfg.Workers reader goroutines against the bound
+// net.PacketConn until Shutdown is called. It blocks until all workers
+// have returned.
+func (f *Frontend) Serve() error {
+	if f.conn == nil {
+		if _, err := CreateServer(f); err != nil {
+			return err
+		}
+	}
+	f.wg.Add(f.cfg.Workers)
+	for i := 0; i < f.cfg.Workers; i++ {
+		go f.readLoop()
+	}
+	go f.reapExpiredConnections()
+	f.wg.Wait()
+	return nil
+}
+
+// Shutdown closes the listening socket, causing every reader goroutine to
+// return.
+func (f *Frontend) Shutdown() error {
+	close(f.stop)
+	if f.conn != nil {
+		return f.conn.Close()
+	}
+	return nil
+}
+
+func (f *Frontend) readLoop() {
+	defer f.wg.Done()
+	for {
+		bufPtr := f.bufPool.Get().(*[]byte)
+		buf := *bufPtr
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			f.bufPool.Put(bufPtr)
+			select {
+			case <-f.stop:
+				return
+			default:
+				log.Errorf("udp: read error: %s", err)
+				continue
+			}
+		}
+		pkt := make([]byte, n)
+		copy(pkt, buf[:n])
+		f.bufPool.Put(bufPtr)
+		f.handlePacket(pkt, addr)
+	}
+}
+
+func (f *Frontend) handlePacket(pkt []byte, addr net.Addr) {
+	if len(pkt) < 16 {
+		return
+	}
+	connID := binary.BigEndian.Uint64(pkt[0:8])
+	action := int32(binary.BigEndian.Uint32(pkt[8:12]))
+	txID := binary.BigEndian.Uint32(pkt[12:16])
+
+	if action != actionConnect && !f.validConnID(addr, connID) {
+		f.sendError(addr, txID, "Connection id expired")
+		return
+	}
+
+	switch action {
+	case actionConnect:
+		f.handleConnect(pkt, addr, txID)
+	case actionAnnounce:
+		f.handleAnnounce(pkt, addr, connID, txID)
+	case actionScrape:
+		f.handleScrape(pkt, addr, connID, txID)
+	default:
+		f.sendError(addr, txID, "Invalid action")
+	}
+}
+
+// randConnID draws a connection id from crypto/rand rather than math/rand.
+// The connection id is BEP 15's only defense against a forged announce
+// from a spoofed source address, so it must be unpredictable to anyone
+// who hasn't completed the connect handshake from the real address.
+func randConnID() (uint64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+func (f *Frontend) handleConnect(pkt []byte, addr net.Addr, txID uint32) {
+	if len(pkt) < connectRequestSize {
+		f.sendError(addr, txID, "Malformed connect request")
+		return
+	}
+	if int64(binary.BigEndian.Uint64(pkt[0:8])) != connectionIDMagic {
+		f.sendError(addr, txID, "Malformed connect request")
+		return
+	}
+	connID, err := randConnID()
+	if err != nil {
+		log.Errorf("udp: failed to generate connection id: %s", err)
+		f.sendError(addr, txID, "Internal error")
+		return
+	}
+	f.connMu.Lock()
+	f.conns[connKey{addr: addr.String(), connID: connID}] = time.Now().Add(connectionIDTTL)
+	f.connMu.Unlock()
+
+	resp := make([]byte, 16)
+	binary.BigEndian.PutUint32(resp[0:4], uint32(actionConnect))
+	binary.BigEndian.PutUint32(resp[4:8], txID)
+	binary.BigEndian.PutUint64(resp[8:16], connID)
+	f.write(addr, resp)
+}
+
+func (f *Frontend) validConnID(addr net.Addr, connID uint64) bool {
+	f.connMu.Lock()
+	defer f.connMu.Unlock()
+	expires, ok := f.conns[connKey{addr: addr.String(), connID: connID}]
+	return ok && time.Now().Before(expires)
+}
+
+func (f *Frontend) reapExpiredConnections() {
+	ticker := time.NewTicker(connectionIDTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case now := <-ticker.C:
+			f.connMu.Lock()
+			for k, expires := range f.conns {
+				if now.After(expires) {
+					delete(f.conns, k)
+				}
+			}
+			f.connMu.Unlock()
+		}
+	}
+}
+
+// parsePasskey scans BEP 15 extension TLVs trailing a fixed-size
+// announce or scrape packet for a URL-data extension and returns its
+// payload as the passkey. Extensions are laid out as repeated
+// [type byte][length byte][length bytes of payload]; a missing or
+// malformed trailer just means no passkey was supplied, which is the
+// common case when no auth hook requires one, so it's never treated as
+// a parse error in its own right.
+func parsePasskey(tail []byte) string {
+	for len(tail) >= 2 {
+		typ := tail[0]
+		n := int(tail[1])
+		tail = tail[2:]
+		if n > len(tail) {
+			return ""
+		}
+		if typ == extensionURLData {
+			return string(tail[:n])
+		}
+		tail = tail[n:]
+	}
+	return ""
+}
+
+// handleAnnounce parses a 98-byte BEP 15 announce packet, plus any
+// trailing extension bytes carrying a passkey, and routes it through the
+// same tracker.Tracker logic and pre/post hook chain the HTTP frontend
+// uses, so stats, storage, passkey handling and approval are shared
+// across both frontends.
+func (f *Frontend) handleAnnounce(pkt []byte, addr net.Addr, connID uint64, txID uint32) {
+	start := time.Now()
+	var event tracker.Event
+	var err error
+	defer func() { recordMetrics("announce", event, start, err) }()
+
+	if len(pkt) < announceRequestSize {
+		err = errMalformedRequest
+		f.sendError(addr, txID, "Malformed announce request")
+		return
+	}
+
+	var infoHash, peerID [20]byte
+	copy(infoHash[:], pkt[16:36])
+	copy(peerID[:], pkt[36:56])
+
+	downloaded := binary.BigEndian.Uint64(pkt[56:64])
+	left := binary.BigEndian.Uint64(pkt[64:72])
+	uploaded := binary.BigEndian.Uint64(pkt[72:80])
+	eventField := binary.BigEndian.Uint32(pkt[80:84])
+	ipField := binary.BigEndian.Uint32(pkt[84:88])
+	numWant := int32(binary.BigEndian.Uint32(pkt[92:96]))
+	port := binary.BigEndian.Uint16(pkt[96:98])
+	event = udpEvent(eventField)
+
+	ip := udpAddrIP(addr)
+	if ipField != 0 {
+		// Unlike the http package's getIP, which honors a client-supplied
+		// ip parameter, the UDP frontend ignores this field and trusts
+		// the socket address, since the field is routinely spoofed and
+		// carries no authentication.
+		_ = ipField
+	}
+
+	req := tracker.AnnounceRequest{
+		InfoHash:   infoHash,
+		PeerID:     peerID,
+		Passkey:    parsePasskey(pkt[announceRequestSize:]),
+		IP:         ip,
+		Port:       port,
+		Uploaded:   uploaded,
+		Downloaded: downloaded,
+		Left:       left,
+		Event:      event,
+		NumWant:    int(numWant),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	for _, hook := range f.preHooks {
+		if hErr := hook.HandleAnnounce(ctx, &req); hErr != nil {
+			err = hErr
+			f.sendError(addr, txID, hErr.Error())
+			return
+		}
+	}
+
+	var resp *tracker.AnnounceResponse
+	resp, err = f.t.Announce(ctx, req)
+	if err != nil {
+		f.sendError(addr, txID, err.Error())
+		return
+	}
+	for _, hook := range f.postHooks {
+		if hErr := hook.HandleAnnounce(ctx, &req, resp); hErr != nil {
+			err = hErr
+			f.sendError(addr, txID, hErr.Error())
+			return
+		}
+	}
+
+	// BEP 15's compact peer list has no room for a "not IPv4" marker, so
+	// peers that aren't representable as one are dropped entirely rather
+	// than left as a zero-filled slot.
+	v4Peers := make([][4]byte, 0, len(resp.Peers))
+	v4Ports := make([]uint16, 0, len(resp.Peers))
+	for _, p := range resp.Peers {
+		v4 := p.IP.To4()
+		if v4 == nil {
+			continue
+		}
+		var ip [4]byte
+		copy(ip[:], v4)
+		v4Peers = append(v4Peers, ip)
+		v4Ports = append(v4Ports, p.Port)
+	}
+
+	out := make([]byte, 20+6*len(v4Peers))
+	binary.BigEndian.PutUint32(out[0:4], uint32(actionAnnounce))
+	binary.BigEndian.PutUint32(out[4:8], txID)
+	binary.BigEndian.PutUint32(out[8:12], uint32(resp.Interval))
+	binary.BigEndian.PutUint32(out[12:16], uint32(resp.Leechers))
+	binary.BigEndian.PutUint32(out[16:20], uint32(resp.Seeders))
+	for i, ip := range v4Peers {
+		off := 20 + i*6
+		copy(out[off:off+4], ip[:])
+		binary.BigEndian.PutUint16(out[off+4:off+6], v4Ports[i])
+	}
+	f.write(addr, out)
+}
+
+// handleScrape parses a BEP 15 scrape packet (up to maxScrapeInfoHashes
+// info hashes), plus any trailing extension bytes carrying a passkey, and
+// responds with per-torrent swarm statistics. A scrape packet carries no
+// hash count, so every whole 20 bytes after the header is taken as an info
+// hash: only a trailer shorter than 20 bytes is read as extension data,
+// and a longer one is parsed as further info hashes.
+func (f *Frontend) handleScrape(pkt []byte, addr net.Addr, connID uint64, txID uint32) {
+	start := time.Now()
+	var err error
+	defer func() { recordMetrics("scrape", tracker.EventNone, start, err) }()
+
+	body := pkt[scrapeHeaderSize:]
+	n := len(body) / 20
+	if n == 0 || n > maxScrapeInfoHashes {
+		err = errMalformedRequest
+		f.sendError(addr, txID, "Malformed scrape request")
+		return
+	}
+
+	hashes := make([][20]byte, n)
+	for i := 0; i < n; i++ {
+		copy(hashes[i][:], body[i*20:i*20+20])
+	}
+	req := tracker.ScrapeRequest{
+		InfoHashes: hashes,
+		Passkey:    parsePasskey(body[n*20:]),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	for _, hook := range f.preHooks {
+		if hErr := hook.HandleScrape(ctx, &req); hErr != nil {
+			err = hErr
+			f.sendError(addr, txID, hErr.Error())
+			return
+		}
+	}
+
+	var resp *tracker.ScrapeResponse
+	resp, err = f.t.Scrape(ctx, req)
+	if err != nil {
+		f.sendError(addr, txID, err.Error())
+		return
+	}
+	for _, hook := range f.postHooks {
+		if hErr := hook.HandleScrape(ctx, &req, resp); hErr != nil {
+			err = hErr
+			f.sendError(addr, txID, hErr.Error())
+			return
+		}
+	}
+
+	out := make([]byte, 8+12*n)
+	binary.BigEndian.PutUint32(out[0:4], uint32(actionScrape))
+	binary.BigEndian.PutUint32(out[4:8], txID)
+	for i, ih := range hashes {
+		stats := resp.Files[ih]
+		off := 8 + i*12
+		binary.BigEndian.PutUint32(out[off:off+4], uint32(stats.Complete))
+		binary.BigEndian.PutUint32(out[off+4:off+8], uint32(stats.Downloaded))
+		binary.BigEndian.PutUint32(out[off+8:off+12], uint32(stats.Incomplete))
+	}
+	f.write(addr, out)
+}
+
+func (f *Frontend) sendError(addr net.Addr, txID uint32, message string) {
+	out := make([]byte, 8+len(message))
+	binary.BigEndian.PutUint32(out[0:4], uint32(actionError))
+	binary.BigEndian.PutUint32(out[4:8], txID)
+	copy(out[8:], message)
+	f.write(addr, out)
+}
+
+func (f *Frontend) write(addr net.Addr, b []byte) {
+	if _, err := f.conn.WriteTo(b, addr); err != nil {
+		log.Errorf("udp: write error to %s: %s", addr, err)
+	}
+}
+
+// recordMetrics publishes into the same metrics.RequestDuration/
+// metrics.Responses collectors the HTTP frontend's metricsMiddleware
+// uses (see http/metrics.go), so operators get one consistent view of
+// tracker traffic regardless of which frontends are enabled. UDP has no
+// equivalent of HTTP's per-error wire code, so the "code" label
+// collapses to "ok"/"error".
+func recordMetrics(endpoint string, event tracker.Event, start time.Time, err error) {
+	code := "ok"
+	if err != nil {
+		code = "error"
+	}
+	metrics.RequestDuration.WithLabelValues(endpoint, string(event)).Observe(time.Since(start).Seconds())
+	metrics.Responses.WithLabelValues(endpoint, string(event), code).Inc()
+}
+
+func udpAddrIP(addr net.Addr) net.IP {
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		return udpAddr.IP.To4()
+	}
+	return nil
+}
+
+func udpEvent(e uint32) tracker.Event {
+	switch e {
+	case 1:
+		return tracker.EventCompleted
+	case 2:
+		return tracker.EventStarted
+	case 3:
+		return tracker.EventStopped
+	default:
+		return tracker.EventNone
+	}
+}
@@ -0,0 +1,160 @@
+package udp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func connectPacket(txID uint32) []byte {
+	pkt := make([]byte, connectRequestSize)
+	binary.BigEndian.PutUint64(pkt[0:8], connectionIDMagic)
+	binary.BigEndian.PutUint32(pkt[8:12], uint32(actionConnect))
+	binary.BigEndian.PutUint32(pkt[12:16], txID)
+	return pkt
+}
+
+func announcePacket(connID uint64, txID uint32, infoHash, peerID [20]byte, extensions []byte) []byte {
+	pkt := make([]byte, announceRequestSize+len(extensions))
+	binary.BigEndian.PutUint64(pkt[0:8], connID)
+	binary.BigEndian.PutUint32(pkt[8:12], uint32(actionAnnounce))
+	binary.BigEndian.PutUint32(pkt[12:16], txID)
+	copy(pkt[16:36], infoHash[:])
+	copy(pkt[36:56], peerID[:])
+	binary.BigEndian.PutUint16(pkt[96:98], 6881)
+	copy(pkt[announceRequestSize:], extensions)
+	return pkt
+}
+
+// newTestFrontend returns a Frontend bound to a real loopback socket, so
+// the response paths exercised by handleConnect/handleAnnounce/
+// handleScrape (which all end in f.write) have a non-nil f.conn to write
+// to, instead of panicking on a nil net.PacketConn.
+func newTestFrontend(t *testing.T) *Frontend {
+	f := NewUDPFrontend(nil, "127.0.0.1:0", Config{}, nil, nil)
+	if _, err := CreateServer(f); err != nil {
+		t.Fatalf("CreateServer: %s", err)
+	}
+	t.Cleanup(func() { _ = f.conn.Close() })
+	return f
+}
+
+func TestHandleConnectIssuesUsableConnectionID(t *testing.T) {
+	f := newTestFrontend(t)
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1}
+
+	f.handleConnect(connectPacket(1), addr, 1)
+
+	f.connMu.Lock()
+	defer f.connMu.Unlock()
+	if len(f.conns) != 1 {
+		t.Fatalf("expected exactly one issued connection id, got %d", len(f.conns))
+	}
+	for k := range f.conns {
+		if k.addr != addr.String() {
+			t.Errorf("connection id bound to %q, want %q", k.addr, addr.String())
+		}
+	}
+}
+
+func TestHandleConnectRejectsMalformedMagic(t *testing.T) {
+	f := newTestFrontend(t)
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1}
+
+	pkt := connectPacket(1)
+	binary.BigEndian.PutUint64(pkt[0:8], 0)
+	f.handleConnect(pkt, addr, 1)
+
+	f.connMu.Lock()
+	defer f.connMu.Unlock()
+	if len(f.conns) != 0 {
+		t.Fatalf("expected no connection id to be issued for a malformed magic, got %d", len(f.conns))
+	}
+}
+
+func TestValidConnIDRejectsUnknownAndExpired(t *testing.T) {
+	f := newTestFrontend(t)
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1}
+
+	if f.validConnID(addr, 1234) {
+		t.Fatal("an id that was never issued must not validate")
+	}
+
+	key := connKey{addr: addr.String(), connID: 1234}
+	f.connMu.Lock()
+	f.conns[key] = time.Now().Add(-time.Second)
+	f.connMu.Unlock()
+
+	if f.validConnID(addr, 1234) {
+		t.Fatal("an expired id must not validate")
+	}
+}
+
+func TestValidConnIDRejectsSpoofedAddress(t *testing.T) {
+	f := newTestFrontend(t)
+	issued := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1}
+	spoofed := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2}
+
+	f.handleConnect(connectPacket(1), issued, 1)
+
+	f.connMu.Lock()
+	var connID uint64
+	for k := range f.conns {
+		connID = k.connID
+	}
+	f.connMu.Unlock()
+
+	if f.validConnID(spoofed, connID) {
+		t.Fatal("a connection id must not validate for an address other than the one it was issued to")
+	}
+}
+
+func TestHandlePacketRejectsShortPackets(t *testing.T) {
+	f := newTestFrontend(t)
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1}
+
+	// Must not panic on a packet too short to contain even the common
+	// header.
+	f.handlePacket(make([]byte, 4), addr)
+}
+
+func TestHandleAnnounceRejectsTooShortPacket(t *testing.T) {
+	f := newTestFrontend(t)
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1}
+
+	var infoHash, peerID [20]byte
+	pkt := announcePacket(1, 1, infoHash, peerID, nil)
+	f.handleAnnounce(pkt[:announceRequestSize-1], addr, 1, 1)
+}
+
+func TestParsePasskey(t *testing.T) {
+	cases := []struct {
+		name string
+		tail []byte
+		want string
+	}{
+		{"empty", nil, ""},
+		{"url data extension", append([]byte{extensionURLData, 4}, []byte("abcd")...), "abcd"},
+		{"skips unknown extension", append(append([]byte{9, 2}, []byte("xx")...), append([]byte{extensionURLData, 3}, []byte("key")...)...), "key"},
+		{"truncated length", []byte{extensionURLData, 10, 'a'}, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := parsePasskey(c.tail); got != c.want {
+				t.Errorf("parsePasskey(%v) = %q, want %q", c.tail, got, c.want)
+			}
+		})
+	}
+}
+
+func TestHandleScrapeRejectsMalformedBody(t *testing.T) {
+	f := newTestFrontend(t)
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1}
+
+	// A scrape header with no info hashes attached is malformed, not an
+	// empty-but-valid request.
+	pkt := make([]byte, scrapeHeaderSize)
+	binary.BigEndian.PutUint32(pkt[8:12], uint32(actionScrape))
+	f.handleScrape(pkt, addr, 1, 1)
+}